@@ -0,0 +1,138 @@
+package charset
+
+import (
+	"strings"
+	"sync"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/ianaindex"
+)
+
+// maxAliasDepth bounds how many alias hops Lookup will follow, as a guard
+// against an accidental alias cycle.
+const maxAliasDepth = 8
+
+// AliasTable maps charset names to encodings, and charset name aliases to
+// the canonical name they should resolve as. It's the extensibility surface
+// behind RegisterEncoding: callers can register their own quirky charsets
+// and aliases instead of needing the declared charset to already be one
+// ianaindex or htmlindex knows about.
+//
+// A *AliasTable is safe for concurrent use.
+type AliasTable struct {
+	mu      sync.RWMutex
+	entries map[string]encoding.Encoding
+	aliases map[string]string
+}
+
+// NewAliasTable returns an empty AliasTable. Most callers want the
+// package-level Aliases table instead, which comes pre-populated with this
+// package's quirks and common real-world aliases.
+func NewAliasTable() *AliasTable {
+	return &AliasTable{
+		entries: make(map[string]encoding.Encoding),
+		aliases: make(map[string]string),
+	}
+}
+
+// Register associates name with enc, so that Lookup(name) and any alias
+// pointing at name return enc. A nil enc disables name: Lookup reports it as
+// found with a nil encoding, and charsetEncoding turns that into an error.
+//
+// Any additional aliases are registered as if passed to Alias(alias, name).
+func (t *AliasTable) Register(name string, enc encoding.Encoding, aliases ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	name = strings.ToLower(name)
+	t.entries[name] = enc
+	for _, alias := range aliases {
+		t.aliases[strings.ToLower(alias)] = name
+	}
+}
+
+// Alias makes from resolve the same way to currently does, without
+// registering an encoding of its own. to is resolved lazily, so it doesn't
+// need to be registered yet, and can itself be a name that ianaindex or
+// htmlindex already knows about.
+func (t *AliasTable) Alias(from, to string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.aliases[strings.ToLower(from)] = strings.ToLower(to)
+}
+
+// resolve follows alias rewrites for name, up to maxAliasDepth hops, and
+// returns the resulting canonical name. t.mu must be held, for read or
+// write.
+func (t *AliasTable) resolve(name string) string {
+	name = strings.ToLower(name)
+	for i := 0; i < maxAliasDepth; i++ {
+		to, ok := t.aliases[name]
+		if !ok || to == name {
+			break
+		}
+		name = to
+	}
+	return name
+}
+
+// Lookup resolves name, following any aliases registered with Register or
+// Alias, to an encoding.Encoding. If no directly registered entry matches,
+// it falls back to the MIME and IANA MIB names known to
+// golang.org/x/text/encoding/ianaindex, and then to the WHATWG names used by
+// HTML5 (golang.org/x/text/encoding/htmlindex).
+//
+// The bool result reports whether name resolved at all; check it before
+// using the encoding, since a registered-but-disabled charset resolves to a
+// nil encoding with ok set to true.
+func (t *AliasTable) Lookup(name string) (enc encoding.Encoding, ok bool) {
+	t.mu.RLock()
+	canonical := t.resolve(name)
+	enc, ok = t.entries[canonical]
+	t.mu.RUnlock()
+	if ok {
+		return enc, true
+	}
+
+	if e, err := ianaindex.MIME.Encoding(canonical); err == nil && e != nil {
+		return e, true
+	}
+	if e, err := ianaindex.MIME.Encoding("cs" + canonical); err == nil && e != nil {
+		return e, true
+	}
+	if e, err := htmlindex.Get(canonical); err == nil && e != nil {
+		return e, true
+	}
+	return nil, false
+}
+
+// Aliases is the AliasTable used by Reader, Writer and RegisterEncoding. It
+// comes pre-populated with this package's quirks (charsets ianaindex and
+// htmlindex don't resolve on all platforms) and with aliases for common
+// vendor-specific misspellings seen in real-world mail.
+var Aliases = NewAliasTable()
+
+func init() {
+	// See RFC 1345 page 62: ANSI_X3.110-1983 is mostly a superset of
+	// ISO-8859-1.
+	Aliases.Register("ansi_x3.110-1983", charmap.ISO8859_1)
+	// See https://icu4c-demos.unicode.org/icu-bin/convexp?s=ALL
+	Aliases.Alias("x-utf_8j", "utf-8")
+
+	// golang.org/x/text/encoding/ianaindex doesn't resolve the IANA MIB
+	// names for plain us-ascii on all platforms, see
+	// https://github.com/golang/go/issues/19421, so it's implemented
+	// directly in ascii.go and registered alongside its well-known aliases.
+	Aliases.Register("us-ascii", usASCII, "ascii", "ansi_x3.4-1968", "iso-ir-6", "ibm367", "cp367")
+
+	// Vendor-specific misspellings and mislabelings that turn up in
+	// real-world mail but aren't in the IANA MIB names ianaindex indexes.
+	// Unlike the registrations above, these resolve through ianaindex/htmlindex
+	// once rewritten, so they're plain aliases rather than registrations.
+	Aliases.Alias("hzgb2312", "hz-gb-2312")
+	Aliases.Alias("x-sjis", "shift_jis")
+	Aliases.Alias("ks_c_5601-1987", "euc-kr")
+	Aliases.Alias("unicode-1-1-utf-8", "utf-8")
+}
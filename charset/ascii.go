@@ -0,0 +1,122 @@
+package charset
+
+import (
+	"fmt"
+	"sync/atomic"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
+)
+
+// ASCIIMode controls how the us-ascii encoding registered in this package's
+// Aliases table handles bytes above 0x7F.
+type ASCIIMode int
+
+const (
+	// ASCIIReplace replaces bytes above 0x7F with U+FFFD on decode. This is
+	// the default, and matches what most mail clients do with "us-ascii".
+	ASCIIReplace ASCIIMode = iota
+	// ASCIIStrict rejects bytes above 0x7F on decode, and runes above
+	// U+007F on encode, with an error.
+	ASCIIStrict
+	// ASCIIPassThrough decodes bytes above 0x7F as Latin-1 (ISO-8859-1),
+	// matching MUAs that mislabel Latin-1 text as us-ascii.
+	ASCIIPassThrough
+)
+
+// asciiMode is the mode used by usASCII, stored as an atomic.Int32 because
+// asciiDecoder.Transform reads it on every byte above 0x7F while SetASCIIMode
+// can be called concurrently from another goroutine. It defaults to
+// ASCIIReplace, whose zero value is 0.
+var asciiMode atomic.Int32
+
+// SetASCIIMode selects how the us-ascii charset (and its aliases, such as
+// "ascii" and "ANSI_X3.4-1968") handles bytes above 0x7F. The default is
+// ASCIIReplace.
+//
+// SetASCIIMode is safe to call while other goroutines are decoding
+// messages.
+func SetASCIIMode(mode ASCIIMode) {
+	asciiMode.Store(int32(mode))
+}
+
+// currentASCIIMode returns the ASCIIMode set via SetASCIIMode.
+func currentASCIIMode() ASCIIMode {
+	return ASCIIMode(asciiMode.Load())
+}
+
+// usASCII implements "us-ascii" directly, since it isn't resolved by
+// ianaindex on all platforms.
+// See https://github.com/golang/go/issues/19421.
+var usASCII encoding.Encoding = &asciiEncoding{}
+
+type asciiEncoding struct{}
+
+func (asciiEncoding) NewDecoder() *encoding.Decoder {
+	return &encoding.Decoder{Transformer: asciiDecoder{}}
+}
+
+func (asciiEncoding) NewEncoder() *encoding.Encoder {
+	return &encoding.Encoder{Transformer: asciiEncoder{}}
+}
+
+type asciiDecoder struct{ transform.NopResetter }
+
+func (asciiDecoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		b := src[nSrc]
+		if b < utf8.RuneSelf {
+			if nDst+1 > len(dst) {
+				return nDst, nSrc, transform.ErrShortDst
+			}
+			dst[nDst] = b
+			nDst++
+			nSrc++
+			continue
+		}
+
+		switch currentASCIIMode() {
+		case ASCIIStrict:
+			return nDst, nSrc, fmt.Errorf("charset: byte 0x%02x is not valid us-ascii", b)
+		case ASCIIPassThrough:
+			size := utf8.RuneLen(rune(b))
+			if nDst+size > len(dst) {
+				return nDst, nSrc, transform.ErrShortDst
+			}
+			nDst += utf8.EncodeRune(dst[nDst:], rune(b))
+		default: // ASCIIReplace
+			if nDst+3 > len(dst) {
+				return nDst, nSrc, transform.ErrShortDst
+			}
+			nDst += utf8.EncodeRune(dst[nDst:], utf8.RuneError)
+		}
+		nSrc++
+	}
+	return nDst, nSrc, nil
+}
+
+type asciiEncoder struct{ transform.NopResetter }
+
+func (asciiEncoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		r, size := utf8.DecodeRune(src[nSrc:])
+		if r == utf8.RuneError && size == 1 {
+			if !atEOF && !utf8.FullRune(src[nSrc:]) {
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+			return nDst, nSrc, fmt.Errorf("charset: invalid UTF-8 in source")
+		}
+		if r > unicode.MaxASCII {
+			return nDst, nSrc, fmt.Errorf("charset: rune %q is not valid us-ascii", r)
+		}
+		if nDst+1 > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		dst[nDst] = byte(r)
+		nDst++
+		nSrc += size
+	}
+	return nDst, nSrc, nil
+}
@@ -0,0 +1,76 @@
+package charset
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/encoding/unicode/utf32"
+)
+
+// boms lists the Unicode byte-order marks SniffBOM recognizes, longest
+// signature first so that e.g. the UTF-32LE BOM isn't mistaken for the
+// UTF-16LE one, which is its prefix.
+var boms = []struct {
+	sig []byte
+	enc encoding.Encoding
+}{
+	{[]byte{0xff, 0xfe, 0x00, 0x00}, utf32.UTF32(utf32.LittleEndian, utf32.IgnoreBOM)},
+	{[]byte{0x00, 0x00, 0xfe, 0xff}, utf32.UTF32(utf32.BigEndian, utf32.IgnoreBOM)},
+	{[]byte{0xef, 0xbb, 0xbf}, unicode.UTF8},
+	{[]byte{0xff, 0xfe}, unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)},
+	{[]byte{0xfe, 0xff}, unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)},
+}
+
+// SniffBOM inspects the start of r for a Unicode byte-order mark and
+// reports the encoding it identifies. The returned reader replays any bytes
+// consumed while sniffing other than the BOM itself, via io.MultiReader,
+// whether or not a BOM was found.
+//
+// When found is true, enc is one of the UTF-8, UTF-16 or UTF-32 encodings
+// and the BOM itself has been stripped from the returned reader. When found
+// is false, enc is nil and out replays r unchanged.
+func SniffBOM(r io.Reader) (enc encoding.Encoding, out io.Reader, found bool) {
+	// 4 bytes covers the longest BOM this package recognizes (UTF-32's).
+	prefix := make([]byte, 4)
+	n, _ := io.ReadFull(r, prefix)
+	prefix = prefix[:n]
+
+	for _, bom := range boms {
+		if bytes.HasPrefix(prefix, bom.sig) {
+			rest := bytes.NewReader(prefix[len(bom.sig):])
+			return bom.enc, io.MultiReader(rest, r), true
+		}
+	}
+
+	return nil, io.MultiReader(bytes.NewReader(prefix), r), false
+}
+
+// maybeSniffBOM sniffs input for a BOM and decides whether it should
+// override charset: that's the case when charset is empty, "unknown", or
+// names something other than the encoding the BOM identifies. out replays
+// any bytes consumed while sniffing, except a found BOM, which is stripped
+// whether or not it overrides charset.
+func maybeSniffBOM(charset string, input io.Reader) (enc encoding.Encoding, out io.Reader, override bool) {
+	bomEnc, out, found := SniffBOM(input)
+	if !found {
+		return nil, out, false
+	}
+
+	declared := strings.ToLower(strings.TrimSpace(charset))
+	if declared != "" && declared != "unknown" {
+		if declEnc, err := charsetEncoding(declared); err == nil {
+			declName, _ := ianaindex.MIME.Name(declEnc)
+			bomName, _ := ianaindex.MIME.Name(bomEnc)
+			if declName != "" && strings.EqualFold(declName, bomName) {
+				// The declared charset already agrees with the BOM.
+				return nil, out, false
+			}
+		}
+	}
+
+	return bomEnc, out, true
+}
@@ -5,61 +5,52 @@
 package charset
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"strings"
 
 	"github.com/emersion/go-message"
 	"golang.org/x/text/encoding"
-	"golang.org/x/text/encoding/charmap"
-	"golang.org/x/text/encoding/htmlindex"
-	"golang.org/x/text/encoding/ianaindex"
-	"golang.org/x/text/encoding/unicode"
 )
 
-// Quirks table for charsets not handled by ianaindex
-//
-// A nil entry disables the charset.
-//
-// For aliases, see
-// https://www.iana.org/assignments/character-sets/character-sets.xhtml
-var charsets = map[string]encoding.Encoding{
-	"ansi_x3.110-1983": charmap.ISO8859_1, // see RFC 1345 page 62, mostly superset of ISO 8859-1
-	"x-utf_8j":         unicode.UTF8,      // alias for UTF-8, see https://icu4c-demos.unicode.org/icu-bin/convexp?s=ALL
-}
-
 func init() {
 	message.CharsetReader = Reader
 	message.CharsetWriter = Writer
 }
 
-// charsetEncoding returns the appropriate encoding.Encoding for the provided charset
+// charsetEncoding returns the appropriate encoding.Encoding for the provided charset.
 func charsetEncoding(charset string) (encoding.Encoding, error) {
-	var err error
-	enc, ok := charsets[strings.ToLower(charset)]
-	if ok && enc == nil {
-		return nil, fmt.Errorf("charset %q: charset is disabled", charset)
-	} else if !ok {
-		enc, err = ianaindex.MIME.Encoding(charset)
-	}
-	if enc == nil {
-		enc, err = ianaindex.MIME.Encoding("cs" + charset)
-	}
-	if enc == nil {
-		enc, err = htmlindex.Get(charset)
-	}
-	if err != nil {
-		return nil, fmt.Errorf("charset %q: %v", charset, err)
+	enc, ok := Aliases.Lookup(charset)
+	if !ok {
+		return nil, fmt.Errorf("charset %q: unsupported charset", charset)
 	}
 	// See https://github.com/golang/go/issues/19421
 	if enc == nil {
-		return nil, fmt.Errorf("charset %q: unsupported charset", charset)
+		return nil, fmt.Errorf("charset %q: charset is disabled", charset)
 	}
 	return enc, nil
 }
 
 // Reader returns an io.Reader that converts the provided charset to UTF-8.
+//
+// If input starts with a Unicode byte-order mark that the declared charset
+// is missing or disagrees with, Reader honors the BOM instead. See
+// SniffBOM.
+//
+// Otherwise, if charset auto-detection has been enabled via
+// EnableAutoDetect, and the provided charset is missing or looks wrong for
+// input, Reader falls back to the detected charset. See DetectingReader.
 func Reader(charset string, input io.Reader) (io.Reader, error) {
+	bomEnc, r, ok := maybeSniffBOM(charset, input)
+	input = r
+	if ok {
+		return bomEnc.NewDecoder().Reader(input), nil
+	}
+
+	if currentDetector() != nil {
+		return DetectingReader(charset, input)
+	}
 	enc, err := charsetEncoding(charset)
 	if err != nil {
 		return input, err
@@ -78,6 +69,104 @@ func Writer(charset string, writer io.Writer) (io.Writer, error) {
 
 // RegisterEncoding registers an encoding. This is intended to be called from
 // the init function in packages that want to support additional charsets.
+//
+// It's a thin wrapper around Aliases.Register kept for backwards
+// compatibility; new code can call Aliases.Register directly, e.g. to also
+// register aliases for name.
 func RegisterEncoding(name string, enc encoding.Encoding) {
-	charsets[name] = enc
+	Aliases.Register(name, enc)
 }
+
+// Convert transcodes input from src to dst, both of which are charset names
+// understood by Reader and Writer. If dst and src are the same name, compared
+// case-insensitively, a copy of input is returned untranscoded; every other
+// path through Convert also returns a newly allocated slice.
+func Convert(dst, src string, input []byte) ([]byte, error) {
+	if strings.EqualFold(dst, src) {
+		return append([]byte(nil), input...), nil
+	}
+
+	r, err := Reader(src, bytes.NewReader(input))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	w, err := Writer(dst, &buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// ConvertString is like Convert, but takes and returns a string.
+func ConvertString(dst, src, s string) (string, error) {
+	b, err := Convert(dst, src, []byte(s))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Transcoder returns an io.WriteCloser that converts bytes written to it
+// from src to dst before writing the result to w, without the caller having
+// to compose Reader and Writer themselves. If dst and src are the same name,
+// compared case-insensitively, writes go straight to w.
+func Transcoder(dst, src string, w io.Writer) (io.WriteCloser, error) {
+	if strings.EqualFold(dst, src) {
+		return nopWriteCloser{w}, nil
+	}
+
+	cw, err := Writer(dst, w)
+	if err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		r, err := Reader(src, pr)
+		if err != nil {
+			pr.CloseWithError(err)
+			done <- err
+			return
+		}
+		_, err = io.Copy(cw, r)
+		if closer, ok := cw.(io.Closer); ok {
+			if cerr := closer.Close(); err == nil {
+				err = cerr
+			}
+		}
+		pr.CloseWithError(err)
+		done <- err
+	}()
+
+	return &transcoder{pw, done}, nil
+}
+
+// transcoder is the io.WriteCloser returned by Transcoder: writes go through
+// a pipe to a goroutine that decodes src and re-encodes to dst, and Close
+// waits for that goroutine to finish flushing before returning.
+type transcoder struct {
+	*io.PipeWriter
+	done chan error
+}
+
+func (t *transcoder) Close() error {
+	if err := t.PipeWriter.Close(); err != nil {
+		return err
+	}
+	return <-t.done
+}
+
+// nopWriteCloser wraps an io.Writer with a no-op Close, for the fast path in
+// Transcoder where no transcoding is actually needed.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,323 @@
+package charset
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		charset string
+		input   []byte
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "utf-8 passthrough",
+			charset: "utf-8",
+			input:   []byte("héllo"),
+			want:    "héllo",
+		},
+		{
+			name:    "iso-8859-1",
+			charset: "iso-8859-1",
+			input:   []byte{'h', 0xe9, 'l', 'l', 'o'},
+			want:    "héllo",
+		},
+		{
+			name:    "unsupported charset",
+			charset: "definitely-not-a-charset",
+			input:   []byte("hello"),
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := Reader(tc.charset, bytes.NewReader(tc.input))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("Reader(%q): expected an error, got none", tc.charset)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Reader(%q): unexpected error: %v", tc.charset, err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("reading decoded output: %v", err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("Reader(%q) = %q, want %q", tc.charset, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSniffBOM(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		found bool
+		rest  []byte
+	}{
+		{
+			name:  "utf-8 bom",
+			input: append([]byte{0xef, 0xbb, 0xbf}, "hi"...),
+			found: true,
+			rest:  []byte("hi"),
+		},
+		{
+			name:  "utf-16le bom",
+			input: append([]byte{0xff, 0xfe}, "h\x00i\x00"...),
+			found: true,
+			rest:  []byte("h\x00i\x00"),
+		},
+		{
+			name:  "no bom",
+			input: []byte("hello"),
+			found: false,
+			rest:  []byte("hello"),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, out, found := SniffBOM(bytes.NewReader(tc.input))
+			if found != tc.found {
+				t.Fatalf("found = %v, want %v", found, tc.found)
+			}
+			got, err := io.ReadAll(out)
+			if err != nil {
+				t.Fatalf("reading sniffed output: %v", err)
+			}
+			if !bytes.Equal(got, tc.rest) {
+				t.Errorf("rest = %q, want %q", got, tc.rest)
+			}
+		})
+	}
+}
+
+func TestReaderHonorsBOMOverDeclaredCharset(t *testing.T) {
+	// A Windows mail client mislabeling a UTF-16LE part as us-ascii.
+	input := append([]byte{0xff, 0xfe}, "h\x00i\x00"...)
+
+	r, err := Reader("us-ascii", bytes.NewReader(input))
+	if err != nil {
+		t.Fatalf("Reader: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading decoded output: %v", err)
+	}
+	if want := "hi"; string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestASCIIModes(t *testing.T) {
+	t.Cleanup(func() { SetASCIIMode(ASCIIReplace) })
+
+	// 0xe9 is not valid 7-bit ASCII.
+	input := []byte{'h', 'i', 0xe9}
+
+	tests := []struct {
+		name    string
+		mode    ASCIIMode
+		want    string
+		wantErr bool
+	}{
+		{name: "replace", mode: ASCIIReplace, want: "hi�"},
+		{name: "pass-through", mode: ASCIIPassThrough, want: "hié"},
+		{name: "strict", mode: ASCIIStrict, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			SetASCIIMode(tc.mode)
+
+			r, err := Reader("us-ascii", bytes.NewReader(input))
+			if err != nil {
+				t.Fatalf("Reader: %v", err)
+			}
+			got, err := io.ReadAll(r)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected a decode error, got none (output %q)", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("reading decoded output: %v", err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// stubDetector is a Detector that always reports the same result, so tests
+// don't depend on github.com/gogs/chardet's actual heuristics.
+type stubDetector struct {
+	name       string
+	confidence int
+}
+
+func (s stubDetector) Detect(data []byte) (string, int, error) {
+	return s.name, s.confidence, nil
+}
+
+func TestDetectingReaderFallsBackOnMojibake(t *testing.T) {
+	t.Cleanup(func() { autoDetect.Store(nil) })
+	EnableAutoDetect(stubDetector{name: "iso-8859-1", confidence: 90})
+
+	// "caf" followed by a lone 0xe9 byte: not valid UTF-8 on its own, but a
+	// valid ISO-8859-1 encoding of "café".
+	input := []byte{'c', 'a', 'f', 0xe9}
+
+	r, err := Reader("utf-8", bytes.NewReader(input))
+	if err != nil {
+		t.Fatalf("Reader: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading decoded output: %v", err)
+	}
+	if want := "café"; string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDetectingReaderKeepsDeclaredCharsetWhenItDecodesCleanly(t *testing.T) {
+	t.Cleanup(func() { autoDetect.Store(nil) })
+	EnableAutoDetect(stubDetector{name: "iso-8859-1", confidence: 100})
+
+	r, err := Reader("utf-8", bytes.NewReader([]byte("héllo")))
+	if err != nil {
+		t.Fatalf("Reader: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading decoded output: %v", err)
+	}
+	if want := "héllo"; string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	orig := []byte("héllo, wörld")
+
+	latin1, err := Convert("iso-8859-1", "utf-8", orig)
+	if err != nil {
+		t.Fatalf("Convert to iso-8859-1: %v", err)
+	}
+
+	back, err := Convert("utf-8", "iso-8859-1", latin1)
+	if err != nil {
+		t.Fatalf("Convert back to utf-8: %v", err)
+	}
+	if string(back) != string(orig) {
+		t.Errorf("round trip = %q, want %q", back, orig)
+	}
+}
+
+func TestConvertNoopCopiesInput(t *testing.T) {
+	orig := []byte("hello")
+
+	got, err := Convert("utf-8", "UTF-8", orig)
+	if err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+	got[0] = 'X'
+	if orig[0] != 'h' {
+		t.Errorf("Convert's dst==src fast path aliased the input slice")
+	}
+}
+
+func TestConvertStringRoundTrip(t *testing.T) {
+	orig := "héllo"
+
+	latin1, err := ConvertString("iso-8859-1", "utf-8", orig)
+	if err != nil {
+		t.Fatalf("ConvertString to iso-8859-1: %v", err)
+	}
+	back, err := ConvertString("utf-8", "iso-8859-1", latin1)
+	if err != nil {
+		t.Fatalf("ConvertString back to utf-8: %v", err)
+	}
+	if back != orig {
+		t.Errorf("round trip = %q, want %q", back, orig)
+	}
+}
+
+func TestTranscoder(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := Transcoder("iso-8859-1", "utf-8", &buf)
+	if err != nil {
+		t.Fatalf("Transcoder: %v", err)
+	}
+	if _, err := io.WriteString(w, "héllo"); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	want := []byte{'h', 0xe9, 'l', 'l', 'o'}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("got %v, want %v", buf.Bytes(), want)
+	}
+}
+
+func TestAliasTable(t *testing.T) {
+	tbl := NewAliasTable()
+	tbl.Register("widget-8", unicode.UTF8, "widget8", "wdgt-8")
+
+	for _, name := range []string{"widget-8", "widget8", "WDGT-8"} {
+		enc, ok := tbl.Lookup(name)
+		if !ok || enc != unicode.UTF8 {
+			t.Errorf("Lookup(%q) = %v, %v; want unicode.UTF8, true", name, enc, ok)
+		}
+	}
+
+	tbl.Register("disabled-charset", nil)
+	if enc, ok := tbl.Lookup("disabled-charset"); !ok || enc != nil {
+		t.Errorf("Lookup(disabled-charset) = %v, %v; want nil, true", enc, ok)
+	}
+
+	if _, ok := tbl.Lookup("does-not-exist"); ok {
+		t.Errorf("Lookup(does-not-exist) reported found")
+	}
+
+	// Alias falls through to ianaindex/htmlindex once rewritten.
+	tbl.Alias("x-widget-alias", "utf-8")
+	if enc, ok := tbl.Lookup("x-widget-alias"); !ok || enc == nil {
+		t.Errorf("Lookup(x-widget-alias) = %v, %v; want a resolved encoding, true", enc, ok)
+	}
+}
+
+func TestAliasTableCycleIsBounded(t *testing.T) {
+	tbl := NewAliasTable()
+	tbl.Alias("a", "b")
+	tbl.Alias("b", "a")
+
+	done := make(chan struct{})
+	go func() {
+		tbl.Lookup("a")
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Lookup did not return: alias cycle isn't bounded")
+	}
+}
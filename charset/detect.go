@@ -0,0 +1,143 @@
+package charset
+
+import (
+	"bufio"
+	"io"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/gogs/chardet"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// sniffLen is the number of bytes peeked from the start of a stream to run
+// charset detection on.
+const sniffLen = 4096
+
+// detectConfidenceThreshold is the minimum confidence (in the [0, 100] range
+// used by chardet) required before a detected charset is trusted over the
+// charset declared by the message.
+const detectConfidenceThreshold = 50
+
+// mojibakeRatio is the fraction of U+FFFD replacement runes in a decoded
+// sample above which the declared charset is considered wrong.
+const mojibakeRatio = 0.05
+
+// Detector guesses the most likely charset of a chunk of text.
+//
+// Implementations are expected to be safe for concurrent use.
+type Detector interface {
+	// Detect returns the IANA name of the most likely charset for data,
+	// along with a confidence score in the range [0, 100].
+	Detect(data []byte) (name string, confidence int, err error)
+}
+
+// chardetDetector adapts github.com/gogs/chardet to the Detector interface.
+type chardetDetector struct {
+	d *chardet.Detector
+}
+
+func (c *chardetDetector) Detect(data []byte) (string, int, error) {
+	result, err := c.d.DetectBest(data)
+	if err != nil {
+		return "", 0, err
+	}
+	return result.Charset, result.Confidence, nil
+}
+
+// defaultDetector is the Detector used when EnableAutoDetect is called with
+// a nil argument.
+var defaultDetector Detector = &chardetDetector{d: chardet.NewTextDetector()}
+
+// autoDetect holds the Detector that Reader falls back to when a declared
+// charset is missing or looks wrong, or a nil *Detector if auto-detection is
+// disabled. It's an atomic.Pointer rather than a plain var because
+// EnableAutoDetect can race with concurrent Reader/DetectingReader calls on
+// a busy mail server.
+//
+// Auto-detection is opt-in: it can change the bytes produced for messages
+// that merely looked broken before, so callers need to ask for it.
+var autoDetect atomic.Pointer[Detector]
+
+// EnableAutoDetect turns on charset auto-detection for Reader, and by
+// extension for message.CharsetReader. When d is nil, a default Detector
+// backed by github.com/gogs/chardet is used.
+//
+// Once enabled, Reader falls back to detection whenever the declared
+// charset is empty, disabled, unsupported, or decodes with a high ratio of
+// U+FFFD replacement characters.
+//
+// EnableAutoDetect is safe to call while other goroutines are decoding
+// messages.
+func EnableAutoDetect(d Detector) {
+	if d == nil {
+		d = defaultDetector
+	}
+	autoDetect.Store(&d)
+}
+
+// currentDetector returns the Detector enabled via EnableAutoDetect, or nil
+// if auto-detection is disabled.
+func currentDetector() Detector {
+	d := autoDetect.Load()
+	if d == nil {
+		return nil
+	}
+	return *d
+}
+
+// DetectingReader wraps input so that, when the charset declared for it is
+// missing or looks wrong, the stream is decoded using the charset returned
+// by the Detector enabled via EnableAutoDetect instead. If auto-detection
+// hasn't been enabled, it behaves exactly like Reader.
+//
+// It peeks at most sniffLen bytes from input to make its decision, then
+// streams the rest through the chosen decoder.
+func DetectingReader(charset string, input io.Reader) (io.Reader, error) {
+	detector := currentDetector()
+	if detector == nil {
+		return Reader(charset, input)
+	}
+
+	br := bufio.NewReaderSize(input, sniffLen)
+	peek, _ := br.Peek(sniffLen)
+
+	if enc, err := charsetEncoding(charset); err == nil && !looksMojibake(enc, peek) {
+		return enc.NewDecoder().Reader(br), nil
+	}
+
+	if name, confidence, err := detector.Detect(peek); err == nil && confidence >= detectConfidenceThreshold {
+		if enc, err := charsetEncoding(name); err == nil {
+			return enc.NewDecoder().Reader(br), nil
+		}
+	}
+
+	// Low confidence: fall back to the declared charset if it's usable,
+	// otherwise assume Windows-1252 as most browsers and mail clients do.
+	if enc, err := charsetEncoding(charset); err == nil {
+		return enc.NewDecoder().Reader(br), nil
+	}
+	return charmap.Windows1252.NewDecoder().Reader(br), nil
+}
+
+// looksMojibake reports whether decoding sample with enc produces an
+// unreasonable number of U+FFFD replacement runes, a sign that enc is the
+// wrong charset for sample.
+func looksMojibake(enc encoding.Encoding, sample []byte) bool {
+	if len(sample) == 0 {
+		return false
+	}
+	decoded, err := enc.NewDecoder().Bytes(sample)
+	if err != nil {
+		return true
+	}
+	var total, bad int
+	for _, r := range string(decoded) {
+		total++
+		if r == utf8.RuneError {
+			bad++
+		}
+	}
+	return total > 0 && float64(bad)/float64(total) > mojibakeRatio
+}